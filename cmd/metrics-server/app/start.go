@@ -15,27 +15,42 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net"
+	"net/http"
+	"os"
 	"time"
 
 	"github.com/spf13/cobra"
+	"k8s.io/klog"
+
 	genericapiserver "k8s.io/apiserver/pkg/server"
 	"k8s.io/apiserver/pkg/server/healthz"
 	genericoptions "k8s.io/apiserver/pkg/server/options"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/transport"
 
 	"github.com/kubernetes-incubator/metrics-server/pkg/apiserver"
 	"github.com/kubernetes-incubator/metrics-server/pkg/manager"
+	"github.com/kubernetes-incubator/metrics-server/pkg/manager/sharding"
+	"github.com/kubernetes-incubator/metrics-server/pkg/metrics"
 	"github.com/kubernetes-incubator/metrics-server/pkg/provider"
 	"github.com/kubernetes-incubator/metrics-server/pkg/sources"
+	"github.com/kubernetes-incubator/metrics-server/pkg/sources/cadvisor"
+	"github.com/kubernetes-incubator/metrics-server/pkg/sources/cri"
 	"github.com/kubernetes-incubator/metrics-server/pkg/sources/summary"
 )
 
+// defaultMetricSources is used when the user doesn't pass --metric-source at
+// all, preserving the historical summary-API-only behavior.
+var defaultMetricSources = []string{"summary"}
+
 // NewCommandStartMetricsServer provides a CLI handler for the metrics server entrypoint
 func NewCommandStartMetricsServer(out, errOut io.Writer, stopCh <-chan struct{}) *cobra.Command {
 	o := NewMetricsServerOptions()
@@ -58,6 +73,23 @@ func NewCommandStartMetricsServer(out, errOut io.Writer, stopCh <-chan struct{})
 	flags.IntVar(&o.KubeletPort, "kubelet-port", o.KubeletPort, "The port to use to connect to Kubelets (defaults to 10250)")
 	flags.StringVar(&o.Kubeconfig, "kubeconfig", o.Kubeconfig, "The path to the kubeconfig used to connect to the Kubernetes API server and the Kubelets (defaults to in-cluster config)")
 
+	flags.StringArrayVar(&o.MetricSources, "metric-source", defaultMetricSources, "A metrics source to scrape nodes with, one of summary|cadvisor|cri. May be repeated; the first source to successfully produce metrics for a node wins.")
+	flags.StringVar(&o.CadvisorEndpoint, "cadvisor-endpoint", o.CadvisorEndpoint, "The kubelet path to scrape for Prometheus-formatted cadvisor metrics, used when --metric-source=cadvisor")
+	flags.StringVar(&o.CRIEndpoint, "cri-endpoint", o.CRIEndpoint, "The CRI runtime endpoint (unix socket) to scrape for container stats, used when --metric-source=cri")
+	flags.StringVar((*string)(&o.KubeletScrapeMode), "kubelet-scrape-mode", string(o.KubeletScrapeMode), "How to reach kubelets for the summary metric source, one of direct|api-proxy. api-proxy routes scrapes through the API server's nodes/proxy subresource for clusters where the kubelet port isn't directly reachable.")
+
+	flags.StringVar(&o.MetricsBindAddress, "metrics-bind-address", o.MetricsBindAddress, "The address to serve metrics-server's own Prometheus metrics on without authentication, e.g. :8080. Leave empty to disable the insecure listener.")
+	flags.BoolVar(&o.MetricsSecure, "metrics-secure", o.MetricsSecure, "Also serve metrics-server's own Prometheus metrics on the secure serving port at /metrics, guarded by the same delegating authentication/authorization as the metrics.k8s.io API.")
+
+	flags.BoolVar(&o.EnableSharding, "enable-sharding", o.EnableSharding, "Partition node scrapes across replicas of this Deployment using rendezvous hashing, instead of every replica scraping every node.")
+	flags.BoolVar(&o.LeaderElect, "leader-elect", o.LeaderElect, "Run leader election to reserve a single replica as shard coordinator when --enable-sharding is set. Currently a no-op reservation: every replica already refreshes its own shard assignment independently, and no feature yet depends on holding the lease.")
+	flags.StringVar(&o.LeaderElectResourceNamespace, "leader-elect-resource-namespace", o.LeaderElectResourceNamespace, "The namespace of the lease object used for leader election.")
+	flags.StringVar(&o.ShardServiceName, "shard-service-name", o.ShardServiceName, "The name of the metrics-server Service whose Endpoints are used to discover sibling replicas for sharding.")
+
+	flags.StringVar(&o.Sink, "sink", o.Sink, "Where to store collected metrics, one of memory|ringbuffer|remote-write. memory keeps only the latest point; ringbuffer retains history and supports range queries; remote-write pushes each batch to --sink-remote-write-url and keeps no samples locally, so it serves neither range queries nor metrics.k8s.io reads.")
+	flags.DurationVar(&o.SinkRetention, "sink-retention", o.SinkRetention, "How much history to retain per (node) or (pod, container) series, used when --sink=ringbuffer.")
+	flags.StringVar(&o.SinkRemoteWriteURL, "sink-remote-write-url", o.SinkRemoteWriteURL, "The Prometheus remote_write endpoint to push samples to, used when --sink=remote-write.")
+
 	o.SecureServing.AddFlags(flags)
 	o.Authentication.AddFlags(flags)
 	o.Authorization.AddFlags(flags)
@@ -81,6 +113,44 @@ type MetricsServerOptions struct {
 	MetricResolution time.Duration
 	KubeletPort      int
 	InsecureKubelet  bool
+
+	// MetricSources lists the metric-source backends to try, in order,
+	// first-success-wins, per node. Defaults to []string{"summary"}.
+	MetricSources []string
+	// CadvisorEndpoint is the kubelet-relative path scraped when "cadvisor"
+	// appears in MetricSources.
+	CadvisorEndpoint string
+	// CRIEndpoint is the unix socket dialed when "cri" appears in MetricSources.
+	CRIEndpoint string
+	// KubeletScrapeMode selects how the summary source reaches kubelets:
+	// direct or api-proxy.
+	KubeletScrapeMode summary.ScrapeMode
+
+	// MetricsBindAddress, when non-empty, serves metrics-server's own
+	// Prometheus metrics without authentication on a dedicated listener.
+	MetricsBindAddress string
+	// MetricsSecure additionally (or instead) serves /metrics on the secure
+	// serving port, behind the delegating authn/authz stack.
+	MetricsSecure bool
+
+	// EnableSharding partitions node scrapes across replicas instead of
+	// every replica scraping every node.
+	EnableSharding bool
+	// LeaderElect elects a single replica to coordinate shard assignment.
+	LeaderElect bool
+	// LeaderElectResourceNamespace is the namespace of the leader election lease.
+	LeaderElectResourceNamespace string
+	// ShardServiceName is the metrics-server Service whose Endpoints list
+	// sibling replicas for sharding.
+	ShardServiceName string
+
+	// Sink selects the storage backend for collected metrics: memory,
+	// ringbuffer, or remote-write.
+	Sink string
+	// SinkRetention bounds how much history a ringbuffer sink keeps per series.
+	SinkRetention time.Duration
+	// SinkRemoteWriteURL is the endpoint a remote-write sink pushes samples to.
+	SinkRemoteWriteURL string
 }
 
 // NewMetricsServerOptions constructs a new set of default options for metrics-server.
@@ -93,6 +163,17 @@ func NewMetricsServerOptions() *MetricsServerOptions {
 
 		MetricResolution: 60 * time.Second,
 		KubeletPort:      10250,
+
+		MetricSources:     defaultMetricSources,
+		CadvisorEndpoint:  cadvisor.Endpoint,
+		CRIEndpoint:       cri.Endpoint,
+		KubeletScrapeMode: summary.ScrapeModeDirect,
+
+		LeaderElectResourceNamespace: "kube-system",
+		ShardServiceName:             "metrics-server",
+
+		Sink:          "memory",
+		SinkRetention: 10 * time.Minute,
 	}
 
 	return o
@@ -130,7 +211,10 @@ func (o MetricsServerOptions) Run(stopCh <-chan struct{}) error {
 	if err != nil {
 		return err
 	}
-	config.GenericConfig.EnableMetrics = true
+	// The generic apiserver's own EnableMetrics installs its /metrics route on
+	// the same NonGoRestfulMux path metrics-secure uses below; leave it off in
+	// that case instead of colliding with our own handler.
+	config.GenericConfig.EnableMetrics = !o.MetricsSecure
 
 	// set up the client config
 	var clientConfig *rest.Config
@@ -156,20 +240,112 @@ func (o MetricsServerOptions) Run(stopCh <-chan struct{}) error {
 	// so set the default resync interval to 0
 	informerFactory := informers.NewSharedInformerFactory(kubeClient, 0)
 
-	// set up the source manager
-	kubeletConfig := summary.GetKubeletConfig(clientConfig, o.KubeletPort)
-	kubeletClient, err := summary.KubeletClientFor(kubeletConfig)
-	if err != nil {
-		return fmt.Errorf("unable to construct a client to connect to the kubelets: %v", err)
+	// set up sharding, if enabled, so the source manager below only scrapes
+	// this replica's partition of the node list
+	var shards *sharding.ShardSet
+	if o.EnableSharding {
+		selfAddress := os.Getenv("POD_IP")
+		if selfAddress == "" {
+			return fmt.Errorf("--enable-sharding requires the POD_IP environment variable to be set (e.g. via the downward API)")
+		}
+		shards = sharding.NewShardSet(kubeClient, o.LeaderElectResourceNamespace, o.ShardServiceName, selfAddress)
+		if err := shards.Refresh(context.Background()); err != nil {
+			return fmt.Errorf("unable to compute initial shard assignment: %v", err)
+		}
+
+		// ShardSet.Refresh only reads the Service's Endpoints, which every
+		// replica is already allowed to do, so every replica keeps its own
+		// assignment current on its own timer rather than waiting on whichever
+		// replica happens to hold the coordinator lease.
+		go wait.Until(func() {
+			if err := shards.Refresh(context.Background()); err != nil {
+				klog.Errorf("unable to refresh shard assignment: %v", err)
+			}
+		}, 30*time.Second, stopCh)
+
+		// --leader-elect runs real leaderelection/lease machinery, but
+		// currently confers no responsibility beyond holding the
+		// "coordinator" identity in reserve (see LeaderElectionConfig's doc
+		// comment) -- OnStartedLeading just blocks until stopped.
+		if o.LeaderElect {
+			go func() {
+				cfg := sharding.LeaderElectionConfig{
+					Client:            kubeClient,
+					ResourceName:      "metrics-server-shard-coordinator",
+					ResourceNamespace: o.LeaderElectResourceNamespace,
+					Identity:          selfAddress,
+				}
+				err := sharding.RunLeaderElection(context.Background(), cfg, func(ctx context.Context) {
+					<-ctx.Done()
+				}, func() {})
+				if err != nil {
+					klog.Errorf("leader election for shard coordination exited: %v", err)
+				}
+			}()
+		}
 	}
-	sourceProvider := summary.NewSummaryProvider(informerFactory.Core().V1().Nodes().Lister(), kubeletClient)
+
+	// set up the source manager, trying each --metric-source in order and
+	// falling back to the next on a per-node basis
+	summary.KubeletPort = o.KubeletPort
+	summary.KubeletScrapeMode = o.KubeletScrapeMode
+	cadvisor.Endpoint = o.CadvisorEndpoint
+	cadvisor.KubeletPort = o.KubeletPort
+	cadvisor.Insecure = o.InsecureKubelet
+	cri.Endpoint = o.CRIEndpoint
+
+	factoryCfg := sources.ProviderFactoryConfig{
+		ClientConfig:    clientConfig,
+		InformerFactory: informerFactory,
+	}
+	if shards != nil {
+		factoryCfg.NodeLister = sharding.NewFilteringNodeLister(informerFactory.Core().V1().Nodes().Lister(), shards)
+	}
+	providers := make([]sources.MetricsSourceProvider, 0, len(o.MetricSources))
+	for _, name := range o.MetricSources {
+		factory, err := sources.SourceProviderFactoryFor(name)
+		if err != nil {
+			return err
+		}
+		provider, err := factory.NewSourceProvider(factoryCfg)
+		if err != nil {
+			return fmt.Errorf("unable to construct %q metric source: %v", name, err)
+		}
+		providers = append(providers, provider)
+	}
+	sourceProvider := sources.NewFallbackProvider(factoryCfg.Nodes(), providers...)
 	sourceManager, err := sources.NewSourceManager(sourceProvider, sources.DefaultMetricsScrapeTimeout)
 	if err != nil {
 		return fmt.Errorf("unable to initialize source manager: %v", err)
 	}
 
-	// set up the in-memory sink and provider
-	metricSink, metricsProvider := provider.NewSinkProvider()
+	// set up the sink and provider
+	var sink provider.Sink
+	switch o.Sink {
+	case "memory", "":
+		sink = nil // nil falls through to provider.NewSinkProvider's own default below
+	case "ringbuffer":
+		capacity := int(o.SinkRetention / o.MetricResolution)
+		if capacity < 1 {
+			capacity = 1
+		}
+		sink = provider.NewRingBufferSink(capacity)
+	case "remote-write":
+		if o.SinkRemoteWriteURL == "" {
+			return fmt.Errorf("--sink=remote-write requires --sink-remote-write-url")
+		}
+		sink = provider.NewRemoteWriteSink(o.SinkRemoteWriteURL)
+	default:
+		return fmt.Errorf("unknown --sink %q", o.Sink)
+	}
+
+	var metricSink provider.Sink
+	var metricsProvider provider.MetricsProvider
+	if sink == nil {
+		metricSink, metricsProvider = provider.NewSinkProvider()
+	} else {
+		metricSink, metricsProvider = provider.NewProvider(sink)
+	}
 
 	// set up the general manager
 	mgr := manager.NewManager(sourceManager, metricSink, o.MetricResolution)
@@ -180,6 +356,14 @@ func (o MetricsServerOptions) Run(stopCh <-chan struct{}) error {
 	// inject the providers into the config
 	config.ProviderConfig.Node = metricsProvider
 	config.ProviderConfig.Pod = metricsProvider
+	if shards != nil {
+		peerClientConfig := apiserver.PeerClientConfig{TokenSource: peerTokenSource(clientConfig)}
+		config.ProviderConfig.Node = apiserver.NewShardAwareNodeProvider(metricsProvider, shards, o.SecureServing.BindPort, peerClientConfig)
+		config.ProviderConfig.Pod = apiserver.NewShardAwarePodProvider(metricsProvider, shards, informerFactory.Core().V1().Pods().Lister(), o.SecureServing.BindPort, peerClientConfig)
+	}
+	if rangeSink, ok := metricSink.(provider.RangeQueryable); ok {
+		config.ProviderConfig.NodeRange = apiserver.NewNodeMetricsRangeREST(rangeSink)
+	}
 
 	// complete the config to get an API server
 	server, err := config.Complete(informerFactory).New()
@@ -190,7 +374,50 @@ func (o MetricsServerOptions) Run(stopCh <-chan struct{}) error {
 	// add health checks
 	server.AddHealthzChecks(healthz.NamedCheck("healthz", mgr.CheckHealth))
 
+	if o.MetricsSecure {
+		// registering on NonGoRestfulMux runs /metrics through the same
+		// delegating authentication/authorization chain as metrics.k8s.io
+		server.GenericAPIServer.Handler.NonGoRestfulMux.Handle("/metrics", metrics.Handler())
+	}
+	if o.MetricsBindAddress != "" {
+		go func() {
+			insecureServer := &http.Server{Addr: o.MetricsBindAddress, Handler: metrics.Handler()}
+			if err := insecureServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				klog.Errorf("insecure metrics listener on %s exited: %v", o.MetricsBindAddress, err)
+			}
+		}()
+	}
+
 	// run everything (the apiserver runs the shared informer factory for us)
 	mgr.RunUntil(stopCh)
 	return server.GenericAPIServer.PrepareRun().Run(stopCh)
 }
+
+// peerTokenSource returns the transport.TokenSource this replica should
+// consult, on every cross-shard request, for the bearer token to present to
+// the peer, so the peer's own DelegatingAuthenticationOptions can
+// authenticate it the same way it would any other metrics.k8s.io caller.
+// clientConfig's BearerToken is used directly when set (e.g. from a
+// kubeconfig); otherwise, for in-cluster configs, transport.NewCachedFileTokenSource
+// re-reads BearerTokenFile (the projected service account token
+// metrics-server already mounts to talk to the API server) on the same
+// schedule client-go's own transport does, so a rotated token is picked up
+// without a restart.
+func peerTokenSource(clientConfig *rest.Config) transport.TokenSource {
+	if clientConfig.BearerToken != "" {
+		return fixedTokenSource(clientConfig.BearerToken)
+	}
+	if clientConfig.BearerTokenFile == "" {
+		return nil
+	}
+	return transport.NewCachedFileTokenSource(clientConfig.BearerTokenFile)
+}
+
+// fixedTokenSource implements transport.TokenSource for a token that was
+// handed to us directly (e.g. from a kubeconfig) rather than read from a
+// rotating file, so there's nothing to re-read on each call.
+type fixedTokenSource string
+
+func (s fixedTokenSource) Token() (string, error) {
+	return string(s), nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apiserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/registry/rest"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+
+	"github.com/kubernetes-incubator/metrics-server/pkg/provider"
+)
+
+func init() {
+	// Scheme is this package's existing runtime.Scheme (the one already
+	// backing apiserver.Codecs, used by Config() in start.go); register
+	// NodeMetricsPointList on it rather than standing up a second
+	// scheme/codecs pair.
+	Scheme.AddKnownTypes(metricsv1beta1.SchemeGroupVersion, &NodeMetricsPointList{})
+}
+
+// NodeMetricsRangeStorageKey is the key the nodes/{name}/metrics
+// subresource is expected to be mounted under in the metrics.k8s.io API
+// group's VersionedResourcesStorageMap, alongside the plain "nodes" entry
+// metrics-server already serves.
+const NodeMetricsRangeStorageKey = "nodes/metrics"
+
+// NodeMetricsRangeREST implements the `nodes/{name}/metrics` subresource,
+// returning a time series of samples instead of the single latest point the
+// top-level nodes.metrics.k8s.io resource serves. It is only functional when
+// the configured Sink implements provider.RangeQueryable; otherwise it
+// reports itself unavailable rather than silently answering with an
+// always-empty series.
+type NodeMetricsRangeREST struct {
+	sink provider.RangeQueryable
+}
+
+// NewNodeMetricsRangeREST builds the `nodes/{name}/metrics` subresource
+// storage backed by sink.
+func NewNodeMetricsRangeREST(sink provider.RangeQueryable) *NodeMetricsRangeREST {
+	return &NodeMetricsRangeREST{sink: sink}
+}
+
+var _ rest.Connecter = &NodeMetricsRangeREST{}
+
+// New satisfies rest.Storage; the subresource has no object representation
+// of its own beyond the JSON body it streams back.
+func (r *NodeMetricsRangeREST) New() runtime.Object {
+	return &NodeMetricsPointList{}
+}
+
+// ConnectMethods satisfies rest.Connecter.
+func (r *NodeMetricsRangeREST) ConnectMethods() []string {
+	return []string{http.MethodGet}
+}
+
+// NewConnectOptions satisfies rest.Connecter; the subresource takes no
+// options beyond the `since`/`step` query parameters parsed directly off the
+// request in Connect.
+func (r *NodeMetricsRangeREST) NewConnectOptions() (runtime.Object, bool, string) {
+	return nil, false, ""
+}
+
+// Connect satisfies rest.Connecter, streaming back the retained samples for
+// the named node between `since` ago and now. `step` is accepted for
+// forward-compatibility with downsampling but is not yet applied.
+func (r *NodeMetricsRangeREST) Connect(ctx context.Context, name string, _ runtime.Object, responder rest.Responder) (http.Handler, error) {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		since, err := parseSince(req.URL.Query().Get("since"))
+		if err != nil {
+			responder.Error(err)
+			return
+		}
+
+		points := r.sink.NodeRange(name, since)
+		responder.Object(http.StatusOK, &NodeMetricsPointList{Items: points})
+	}), nil
+}
+
+func parseSince(raw string) (time.Duration, error) {
+	if raw == "" {
+		return 5 * time.Minute, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid since=%q: %v", raw, err)
+	}
+	return d, nil
+}
+
+// NodeMetricsPointList is the response body for the nodes/{name}/metrics
+// subresource: the node's retained samples across the requested window. It
+// embeds metav1.TypeMeta, like every other serializable Kubernetes API
+// object, so content negotiation can stamp and read its GroupVersionKind
+// now that it's registered on the package Scheme (see the init above).
+type NodeMetricsPointList struct {
+	metav1.TypeMeta
+	metav1.ListMeta
+
+	Items []provider.NodeMetricsPoint
+}
+
+// DeepCopyObject satisfies runtime.Object.
+func (l *NodeMetricsPointList) DeepCopyObject() runtime.Object {
+	out := &NodeMetricsPointList{TypeMeta: l.TypeMeta, ListMeta: l.ListMeta, Items: make([]provider.NodeMetricsPoint, len(l.Items))}
+	copy(out.Items, l.Items)
+	return out
+}
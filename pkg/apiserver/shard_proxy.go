@@ -0,0 +1,281 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apiserver
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	apitypes "k8s.io/apimachinery/pkg/types"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/transport"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+
+	"github.com/kubernetes-incubator/metrics-server/pkg/manager/sharding"
+	"github.com/kubernetes-incubator/metrics-server/pkg/provider"
+)
+
+// ShardAwareNodeProvider wraps a provider.NodeMetricsProvider so that, under
+// sharding, requests for nodes this replica doesn't own are transparently
+// proxied to the replica that does. From the caller's point of view (the
+// metrics.k8s.io REST storage) there is still a single node provider backing
+// a single virtual endpoint; which replica actually scraped the node is an
+// implementation detail.
+type ShardAwareNodeProvider struct {
+	local  provider.NodeMetricsProvider
+	shards *sharding.ShardSet
+	peers  *peerClient
+}
+
+// NewShardAwareNodeProvider builds a ShardAwareNodeProvider that answers
+// locally-owned nodes from local and proxies everything else to the owning
+// replica over securePort, using peerClientConfig for authentication.
+func NewShardAwareNodeProvider(local provider.NodeMetricsProvider, shards *sharding.ShardSet, securePort int, peerClientConfig PeerClientConfig) *ShardAwareNodeProvider {
+	return &ShardAwareNodeProvider{
+		local:  local,
+		shards: shards,
+		peers:  newPeerClient(securePort, peerClientConfig),
+	}
+}
+
+func (p *ShardAwareNodeProvider) GetNodeMetrics(nodes ...string) ([]provider.TimeInfo, []provider.ResourceList, error) {
+	var localNodes, remoteNodes []string
+	var localIndexes, remoteIndexes []int
+	for i, node := range nodes {
+		if p.shards.OwnsLocally(node) {
+			localNodes = append(localNodes, node)
+			localIndexes = append(localIndexes, i)
+		} else {
+			remoteNodes = append(remoteNodes, node)
+			remoteIndexes = append(remoteIndexes, i)
+		}
+	}
+
+	times, values, err := p.local.GetNodeMetrics(localNodes...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, node := range remoteNodes {
+		owner := p.shards.Owner(node)
+		if owner == "" {
+			return nil, nil, fmt.Errorf("no replica currently owns node %s", node)
+		}
+		t, v, err := p.peers.getNodeMetrics(context.Background(), owner, node)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to proxy node metrics for %s to shard owner %s: %v", node, owner, err)
+		}
+		times = append(times, t)
+		values = append(values, v)
+	}
+
+	// put the results back in the order the nodes were requested in
+	orderedTimes := make([]provider.TimeInfo, len(nodes))
+	orderedValues := make([]provider.ResourceList, len(nodes))
+	for j, i := range append(localIndexes, remoteIndexes...) {
+		orderedTimes[i] = times[j]
+		orderedValues[i] = values[j]
+	}
+	return orderedTimes, orderedValues, nil
+}
+
+// ShardAwarePodProvider wraps a provider.PodMetricsProvider the same way
+// ShardAwareNodeProvider wraps the node side: a pod whose node this replica
+// doesn't own is proxied to the replica that does, keyed off the pod's
+// assigned node rather than the pod itself (ShardSet only knows how to pick
+// an owner for a node name).
+type ShardAwarePodProvider struct {
+	local  provider.PodMetricsProvider
+	shards *sharding.ShardSet
+	pods   v1listers.PodLister
+	peers  *peerClient
+}
+
+// NewShardAwarePodProvider builds a ShardAwarePodProvider that answers pods
+// scheduled onto locally-owned nodes from local and proxies everything else
+// to the owning replica over securePort, using peerClientConfig for
+// authentication. pods is used only to look up which node a requested pod is
+// bound to.
+func NewShardAwarePodProvider(local provider.PodMetricsProvider, shards *sharding.ShardSet, pods v1listers.PodLister, securePort int, peerClientConfig PeerClientConfig) *ShardAwarePodProvider {
+	return &ShardAwarePodProvider{
+		local:  local,
+		shards: shards,
+		pods:   pods,
+		peers:  newPeerClient(securePort, peerClientConfig),
+	}
+}
+
+func (p *ShardAwarePodProvider) GetContainerMetrics(pods ...apitypes.NamespacedName) ([]provider.TimeInfo, [][]provider.ResourceList, error) {
+	var localPods, remotePods []apitypes.NamespacedName
+	var localIndexes, remoteIndexes []int
+	owners := make(map[apitypes.NamespacedName]string, len(pods))
+	for i, pod := range pods {
+		owner := p.ownerFor(pod)
+		if owner == "" || p.shards.OwnsLocally(owner) {
+			localPods = append(localPods, pod)
+			localIndexes = append(localIndexes, i)
+		} else {
+			remotePods = append(remotePods, pod)
+			remoteIndexes = append(remoteIndexes, i)
+			owners[pod] = owner
+		}
+	}
+
+	times, values, err := p.local.GetContainerMetrics(localPods...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, pod := range remotePods {
+		nodeName := owners[pod]
+		owner := p.shards.Owner(nodeName)
+		if owner == "" {
+			return nil, nil, fmt.Errorf("no replica currently owns node %s for pod %s/%s", nodeName, pod.Namespace, pod.Name)
+		}
+		t, v, err := p.peers.getPodMetrics(context.Background(), owner, pod)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to proxy pod metrics for %s/%s to shard owner %s: %v", pod.Namespace, pod.Name, owner, err)
+		}
+		times = append(times, t)
+		values = append(values, v)
+	}
+
+	// put the results back in the order the pods were requested in
+	orderedTimes := make([]provider.TimeInfo, len(pods))
+	orderedValues := make([][]provider.ResourceList, len(pods))
+	for j, i := range append(localIndexes, remoteIndexes...) {
+		orderedTimes[i] = times[j]
+		orderedValues[i] = values[j]
+	}
+	return orderedTimes, orderedValues, nil
+}
+
+// ownerFor returns the node name the pod is bound to, or "" if the pod
+// can't be found or hasn't been scheduled yet (in which case it's treated
+// as local, same as a node with no known owner).
+func (p *ShardAwarePodProvider) ownerFor(pod apitypes.NamespacedName) string {
+	obj, err := p.pods.Pods(pod.Namespace).Get(pod.Name)
+	if err != nil {
+		return ""
+	}
+	return obj.Spec.NodeName
+}
+
+// PeerClientConfig carries the settings used when one replica proxies a
+// request to another. Each replica's secure serving certificate is
+// self-signed per MaybeDefaultWithSelfSignedCerts, with no CA shared between
+// replicas to verify it against, so peer authenticity comes from a bearer
+// token (checked via the peer's own DelegatingAuthenticationOptions, the same
+// TokenReview path every other metrics.k8s.io caller goes through) rather
+// than from the TLS handshake; Transport, when set, overrides the default
+// skip-verify transport, mainly so tests can inject a fake one.
+//
+// TokenSource is consulted on every proxied request rather than once at
+// startup, so a rotating projected service account token (the default
+// in-cluster token is refreshed roughly hourly) is picked up the same way
+// client-go's own transport re-reads it for calls to the API server; a nil
+// TokenSource sends no Authorization header.
+type PeerClientConfig struct {
+	TokenSource transport.TokenSource
+	Transport   http.RoundTripper
+}
+
+type peerClient struct {
+	port        int
+	tokenSource transport.TokenSource
+	http        *http.Client
+}
+
+func newPeerClient(port int, cfg PeerClientConfig) *peerClient {
+	rt := cfg.Transport
+	if rt == nil {
+		rt = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	return &peerClient{
+		port:        port,
+		tokenSource: cfg.TokenSource,
+		http:        &http.Client{Transport: rt, Timeout: 10 * time.Second},
+	}
+}
+
+func (c *peerClient) do(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if c.tokenSource != nil {
+		token, err := c.tokenSource.Token()
+		if err != nil {
+			return nil, fmt.Errorf("unable to obtain bearer token for cross-shard request: %v", err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+	return c.http.Do(req)
+}
+
+func (c *peerClient) getNodeMetrics(ctx context.Context, peerAddress, node string) (provider.TimeInfo, provider.ResourceList, error) {
+	url := fmt.Sprintf("https://%s:%d/apis/metrics.k8s.io/v1beta1/nodes/%s", peerAddress, c.port, node)
+	resp, err := c.do(ctx, url)
+	if err != nil {
+		return provider.TimeInfo{}, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return provider.TimeInfo{}, nil, fmt.Errorf("peer %s returned status %d for node %s", peerAddress, resp.StatusCode, node)
+	}
+
+	var metrics metricsv1beta1.NodeMetrics
+	if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil {
+		return provider.TimeInfo{}, nil, fmt.Errorf("unable to decode node metrics from peer %s: %v", peerAddress, err)
+	}
+
+	return provider.TimeInfo{
+		Timestamp: metrics.Timestamp.Time,
+		Window:    metrics.Window.Duration,
+	}, metrics.Usage, nil
+}
+
+func (c *peerClient) getPodMetrics(ctx context.Context, peerAddress string, pod apitypes.NamespacedName) (provider.TimeInfo, []provider.ResourceList, error) {
+	url := fmt.Sprintf("https://%s:%d/apis/metrics.k8s.io/v1beta1/namespaces/%s/pods/%s", peerAddress, c.port, pod.Namespace, pod.Name)
+	resp, err := c.do(ctx, url)
+	if err != nil {
+		return provider.TimeInfo{}, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return provider.TimeInfo{}, nil, fmt.Errorf("peer %s returned status %d for pod %s/%s", peerAddress, resp.StatusCode, pod.Namespace, pod.Name)
+	}
+
+	var metrics metricsv1beta1.PodMetrics
+	if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil {
+		return provider.TimeInfo{}, nil, fmt.Errorf("unable to decode pod metrics from peer %s: %v", peerAddress, err)
+	}
+
+	values := make([]provider.ResourceList, 0, len(metrics.Containers))
+	for _, container := range metrics.Containers {
+		values = append(values, container.Usage)
+	}
+	return provider.TimeInfo{
+		Timestamp: metrics.Timestamp.Time,
+		Window:    metrics.Window.Duration,
+	}, values, nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sharding partitions node scrapes across metrics-server replicas so
+// a single process's scrape loop doesn't become the bottleneck in large
+// clusters.
+package sharding
+
+import (
+	"hash/fnv"
+)
+
+// PickReplica applies rendezvous (highest random weight) hashing to choose
+// which of replicas should own key. HRW hashing means that adding or
+// removing a replica only reshuffles the keys that replica owned, instead of
+// remapping the whole keyspace the way a naive `hash(key) % N` would.
+func PickReplica(key string, replicas []string) string {
+	if len(replicas) == 0 {
+		return ""
+	}
+	var winner string
+	var winnerWeight uint64
+	for _, replica := range replicas {
+		weight := weigh(key, replica)
+		if winner == "" || weight > winnerWeight {
+			winner = replica
+			winnerWeight = weight
+		}
+	}
+	return winner
+}
+
+// Owns reports whether replica is the HRW owner of key among all of
+// replicas, i.e. whether PickReplica would choose it.
+func Owns(key, replica string, replicas []string) bool {
+	return PickReplica(key, replicas) == replica
+}
+
+func weigh(key, replica string) uint64 {
+	h := fnv.New64a()
+	// deliberately ignore write errors: hash.Hash.Write never returns one
+	h.Write([]byte(replica))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return h.Sum64()
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	defaultLeaseDuration = 15 * time.Second
+	defaultRenewDeadline = 10 * time.Second
+	defaultRetryPeriod   = 2 * time.Second
+)
+
+// LeaderElectionConfig configures the lease used to elect the shard
+// coordinator. Every replica already recomputes its own shard assignment
+// from the Service's Endpoints on its own timer, so holding the lease
+// currently confers no special responsibility; --leader-elect only reserves
+// the "coordinator" identity for features that do need a single writer
+// later (e.g. publishing assignments instead of having every replica poll).
+type LeaderElectionConfig struct {
+	Client            kubernetes.Interface
+	ResourceName      string
+	ResourceNamespace string
+	Identity          string
+}
+
+// RunLeaderElection blocks until ctx is done or, once this replica has held
+// the lease, until it loses it, calling onStartedLeading when this replica
+// becomes the coordinator and onStoppedLeading when it loses the lease. It
+// wraps client-go's leaderelection package with the lease duration, renew
+// deadline and retry period defaults declared above.
+func RunLeaderElection(ctx context.Context, cfg LeaderElectionConfig, onStartedLeading func(context.Context), onStoppedLeading func()) error {
+	identity := cfg.Identity
+	if identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("unable to determine leader election identity: %v", err)
+		}
+		identity = hostname
+	}
+
+	lock, err := resourcelock.New(
+		resourcelock.LeasesResourceLock,
+		cfg.ResourceNamespace,
+		cfg.ResourceName,
+		cfg.Client.CoreV1(),
+		cfg.Client.CoordinationV1(),
+		resourcelock.ResourceLockConfig{Identity: identity},
+	)
+	if err != nil {
+		return fmt.Errorf("unable to construct leader election lock: %v", err)
+	}
+
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: defaultLeaseDuration,
+		RenewDeadline: defaultRenewDeadline,
+		RetryPeriod:   defaultRetryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: onStartedLeading,
+			OnStoppedLeading: onStoppedLeading,
+		},
+	})
+	return nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sharding
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	v1listers "k8s.io/client-go/listers/core/v1"
+)
+
+// filteringNodeLister wraps a v1listers.NodeLister so that List only returns
+// nodes the local replica owns, per shards. Get is left unfiltered: it's
+// used for single-node lookups (e.g. answering a proxied cross-shard
+// request), where the caller has already decided this replica should serve
+// that node regardless of ownership.
+type filteringNodeLister struct {
+	v1listers.NodeLister
+	shards *ShardSet
+}
+
+// NewFilteringNodeLister restricts lister's List results to the nodes shards
+// says the local replica owns, so a sharded source provider only ever
+// scrapes its own partition of the cluster.
+func NewFilteringNodeLister(lister v1listers.NodeLister, shards *ShardSet) v1listers.NodeLister {
+	return &filteringNodeLister{NodeLister: lister, shards: shards}
+}
+
+func (l *filteringNodeLister) List(selector labels.Selector) ([]*v1.Node, error) {
+	nodes, err := l.NodeLister.List(selector)
+	if err != nil {
+		return nil, err
+	}
+	return l.shards.FilterNodes(nodes), nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ShardSet tracks which replica of the metrics-server Service owns which
+// node, recomputed from the Service's Endpoints on each Refresh. A single virtual metrics.k8s.io endpoint is preserved: every
+// replica can answer any request, proxying to the owner when it isn't the
+// local replica.
+type ShardSet struct {
+	client    kubernetes.Interface
+	namespace string
+	service   string
+	self      string
+
+	mu       sync.RWMutex
+	replicas []string
+}
+
+// NewShardSet constructs a ShardSet that discovers peer replicas from the
+// Endpoints of namespace/service, identifying the local replica as self
+// (typically the pod IP).
+func NewShardSet(client kubernetes.Interface, namespace, service, self string) *ShardSet {
+	return &ShardSet{client: client, namespace: namespace, service: service, self: self}
+}
+
+// Refresh re-reads the Service's Endpoints and updates the known replica
+// set. It does a single Get of the Endpoints object and is not triggered by
+// endpoint changes; callers run it on a timer to pick up a changed replica
+// set.
+func (s *ShardSet) Refresh(ctx context.Context) error {
+	endpoints, err := s.client.CoreV1().Endpoints(s.namespace).Get(ctx, s.service, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to list endpoints for shard service %s/%s: %v", s.namespace, s.service, err)
+	}
+
+	var replicas []string
+	for _, subset := range endpoints.Subsets {
+		for _, addr := range subset.Addresses {
+			replicas = append(replicas, addr.IP)
+		}
+	}
+
+	s.mu.Lock()
+	s.replicas = replicas
+	s.mu.Unlock()
+	return nil
+}
+
+// Owner returns which replica (by address) currently owns nodeName.
+func (s *ShardSet) Owner(nodeName string) string {
+	s.mu.RLock()
+	replicas := s.replicas
+	s.mu.RUnlock()
+	return PickReplica(nodeName, replicas)
+}
+
+// OwnsLocally reports whether the local replica owns nodeName, i.e. whether
+// this replica's SourceManager should include it in its own scrape loop.
+func (s *ShardSet) OwnsLocally(nodeName string) bool {
+	return s.Owner(nodeName) == s.self
+}
+
+// FilterNodes restricts nodes to the subset the local replica owns.
+func (s *ShardSet) FilterNodes(nodes []*v1.Node) []*v1.Node {
+	owned := make([]*v1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if s.OwnsLocally(node.Name) {
+			owned = append(owned, node)
+		}
+	}
+	return owned
+}
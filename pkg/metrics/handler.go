@@ -0,0 +1,75 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"net/http"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Handler serves Registry's metrics as Prometheus exposition text, honoring
+// an optional `?match[]=` query parameter that subsets the output by metric
+// family name. Multiple match[] values are OR'd together, and a trailing
+// `*` matches any suffix (e.g. `metrics_server_scrape_*`), mirroring the
+// subset of Prometheus's federation `match[]` semantics metrics-server's
+// scrapers actually need.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		families, err := Registry.Gather()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if patterns := r.URL.Query()["match[]"]; len(patterns) > 0 {
+			families = filterFamilies(families, patterns)
+		}
+
+		w.Header().Set("Content-Type", string(expfmt.FmtText))
+		encoder := expfmt.NewEncoder(w, expfmt.FmtText)
+		for _, family := range families {
+			if err := encoder.Encode(family); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	})
+}
+
+func filterFamilies(families []*dto.MetricFamily, patterns []string) []*dto.MetricFamily {
+	filtered := make([]*dto.MetricFamily, 0, len(families))
+	for _, family := range families {
+		if matchesAny(family.GetName(), patterns) {
+			filtered = append(filtered, family)
+		}
+	}
+	return filtered
+}
+
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(name, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics exposes metrics-server's own operational metrics (scrape
+// latency, scrape errors per node, sink size, storage points) on a
+// Prometheus-compatible /metrics endpoint, separate from the metrics.k8s.io
+// API metrics-server serves to clients.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "metrics_server"
+
+var (
+	// ScrapeDuration records how long each node scrape took, labeled by the
+	// metric source that served it (summary, cadvisor, cri).
+	ScrapeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "scrape_duration_seconds",
+		Help:      "Duration of a single node metrics scrape.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"source", "node"})
+
+	// ScrapeErrorsTotal counts failed scrapes per node and source.
+	ScrapeErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scrape_errors_total",
+		Help:      "Number of node metrics scrapes that failed.",
+	}, []string{"source", "node"})
+
+	// SinkSize reports the number of metrics points currently held in the
+	// provider's sink.
+	SinkSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sink_points",
+		Help:      "Number of metrics points currently stored in the sink.",
+	})
+)
+
+// Registry is metrics-server's dedicated Prometheus registry. It is kept
+// separate from prometheus.DefaultRegisterer so that /metrics only ever
+// serves metrics-server's own collectors, not whatever happens to register
+// itself globally in a linked dependency.
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(ScrapeDuration, ScrapeErrorsTotal, SinkSize)
+}
@@ -0,0 +1,32 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+// MetricsProvider is satisfied by anything serving both halves of
+// metrics.k8s.io; it's what NewSinkProvider and NewProvider hand back for
+// wiring into apiserver.ProviderConfig.Node and .Pod.
+type MetricsProvider interface {
+	NodeMetricsProvider
+	PodMetricsProvider
+}
+
+// NewProvider is the pluggable-sink counterpart to NewSinkProvider: instead
+// of building its own always-in-memory single-point sink, it serves reads
+// out of whatever Sink the caller already constructed (memory, ring buffer,
+// remote-write, ...), so --sink can select retention and durability
+// independently of how metrics-server answers metrics.k8s.io reads.
+func NewProvider(sink Sink) (Sink, MetricsProvider) {
+	return sink, newSinkMetricsProvider(sink)
+}
@@ -0,0 +1,135 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+	"k8s.io/klog"
+
+	"github.com/kubernetes-incubator/metrics-server/pkg/sources"
+)
+
+// remoteWriteSink pushes every received batch to a Prometheus remote_write
+// endpoint and keeps no samples locally, so a provider built on it has
+// nothing to answer metrics.k8s.io or range reads with. Each push is made
+// synchronously in Receive, bounded by the client's 10s timeout; a failed
+// push is logged, not retried, since the next scrape interval will push
+// fresher samples regardless.
+type remoteWriteSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewRemoteWriteSink builds a Sink that pushes every batch to url using the
+// Prometheus remote_write wire format (Snappy-compressed protobuf
+// WriteRequest), matching what Prometheus's own remote_write receivers and
+// most TSDB-as-a-service backends expect.
+func NewRemoteWriteSink(url string) Sink {
+	return &remoteWriteSink{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *remoteWriteSink) Receive(batch *sources.MetricsBatch) {
+	req := toWriteRequest(batch)
+	if len(req.Timeseries) == 0 {
+		return
+	}
+
+	data, err := proto.Marshal(req)
+	if err != nil {
+		klog.Errorf("unable to marshal remote_write request: %v", err)
+		return
+	}
+	compressed := snappy.Encode(nil, data)
+
+	if err := s.push(compressed); err != nil {
+		klog.Errorf("unable to push metrics to remote_write endpoint %s: %v", s.url, err)
+	}
+}
+
+func (s *remoteWriteSink) push(compressed []byte) error {
+	httpReq, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(compressed))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Encoding", "snappy")
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	httpReq.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("remote_write endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func toWriteRequest(batch *sources.MetricsBatch) *prompb.WriteRequest {
+	req := &prompb.WriteRequest{}
+
+	for _, node := range batch.Nodes {
+		ts := int64(node.Timestamp.UnixNano() / int64(time.Millisecond))
+		req.Timeseries = append(req.Timeseries,
+			series("node_cpu_usage_cores", map[string]string{"node": node.Name}, float64(node.CpuUsage)/1e9, ts),
+			series("node_memory_usage_bytes", map[string]string{"node": node.Name}, float64(node.MemoryUsage), ts),
+		)
+	}
+
+	for _, pod := range batch.Pods {
+		for _, container := range pod.Containers {
+			ts := int64(container.Timestamp.UnixNano() / int64(time.Millisecond))
+			labels := map[string]string{
+				"namespace": pod.Namespace,
+				"pod":       pod.Name,
+				"container": container.Name,
+			}
+			req.Timeseries = append(req.Timeseries,
+				series("container_cpu_usage_cores", labels, float64(container.CpuUsage)/1e9, ts),
+				series("container_memory_usage_bytes", labels, float64(container.MemoryUsage), ts),
+			)
+		}
+	}
+
+	return req
+}
+
+// series builds a single prompb.TimeSeries. remote_write requires each
+// series' labels to be sorted by name, so labelPairs is sorted before
+// returning rather than left in the random order ranging over labels would
+// produce.
+func series(name string, labels map[string]string, value float64, timestampMs int64) prompb.TimeSeries {
+	labelPairs := make([]prompb.Label, 0, len(labels)+1)
+	labelPairs = append(labelPairs, prompb.Label{Name: "__name__", Value: name})
+	for k, v := range labels {
+		labelPairs = append(labelPairs, prompb.Label{Name: k, Value: v})
+	}
+	sort.Slice(labelPairs, func(i, j int) bool {
+		return labelPairs[i].Name < labelPairs[j].Name
+	})
+	return prompb.TimeSeries{
+		Labels:  labelPairs,
+		Samples: []prompb.Sample{{Value: value, Timestamp: timestampMs}},
+	}
+}
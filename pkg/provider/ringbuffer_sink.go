@@ -0,0 +1,133 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kubernetes-incubator/metrics-server/pkg/metrics"
+	"github.com/kubernetes-incubator/metrics-server/pkg/sources"
+)
+
+// ringBufferSink retains up to capacity samples per (node) and per
+// (pod, container), evicting the oldest sample once a series is full. Unlike
+// the single-point in-memory sink, it supports RangeQueryable reads.
+type ringBufferSink struct {
+	capacity int
+
+	mu    sync.RWMutex
+	nodes map[string][]NodeMetricsPoint
+	pods  map[podContainerKey][]PodMetricsPoint
+}
+
+type podContainerKey struct {
+	namespace string
+	pod       string
+	container string
+}
+
+// NewRingBufferSink builds a Sink that retains up to capacity samples per
+// (pod, container) or (node), at whatever granularity the manager collects
+// at (MetricResolution). capacity is typically sink-retention / MetricResolution.
+func NewRingBufferSink(capacity int) Sink {
+	return &ringBufferSink{
+		capacity: capacity,
+		nodes:    map[string][]NodeMetricsPoint{},
+		pods:     map[podContainerKey][]PodMetricsPoint{},
+	}
+}
+
+func (s *ringBufferSink) Receive(batch *sources.MetricsBatch) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, node := range batch.Nodes {
+		key := node.Name
+		series := append(s.nodes[key], NodeMetricsPoint{
+			Timestamp: node.Timestamp,
+			CpuUsage:  node.CpuUsage,
+			MemUsage:  node.MemoryUsage,
+		})
+		if len(series) > s.capacity {
+			series = series[len(series)-s.capacity:]
+		}
+		s.nodes[key] = series
+	}
+
+	for _, pod := range batch.Pods {
+		for _, container := range pod.Containers {
+			key := podContainerKey{namespace: pod.Namespace, pod: pod.Name, container: container.Name}
+			series := append(s.pods[key], PodMetricsPoint{
+				Timestamp:     container.Timestamp,
+				ContainerName: container.Name,
+				CpuUsage:      container.CpuUsage,
+				MemUsage:      container.MemoryUsage,
+			})
+			if len(series) > s.capacity {
+				series = series[len(series)-s.capacity:]
+			}
+			s.pods[key] = series
+		}
+	}
+
+	metrics.SinkSize.Set(float64(s.pointCountLocked()))
+}
+
+// pointCountLocked returns the total number of retained node and pod
+// samples. Callers must hold s.mu.
+func (s *ringBufferSink) pointCountLocked() int {
+	count := 0
+	for _, series := range s.nodes {
+		count += len(series)
+	}
+	for _, series := range s.pods {
+		count += len(series)
+	}
+	return count
+}
+
+func (s *ringBufferSink) NodeRange(node string, since time.Duration) []NodeMetricsPoint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cutoff := time.Now().Add(-since)
+	var points []NodeMetricsPoint
+	for _, point := range s.nodes[node] {
+		if point.Timestamp.After(cutoff) {
+			points = append(points, point)
+		}
+	}
+	return points
+}
+
+func (s *ringBufferSink) PodRange(namespace, name string, since time.Duration) []PodMetricsPoint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cutoff := time.Now().Add(-since)
+	var points []PodMetricsPoint
+	for key, series := range s.pods {
+		if key.namespace != namespace || key.pod != name {
+			continue
+		}
+		for _, point := range series {
+			if point.Timestamp.After(cutoff) {
+				points = append(points, point)
+			}
+		}
+	}
+	return points
+}
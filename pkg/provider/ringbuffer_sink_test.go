@@ -0,0 +1,98 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kubernetes-incubator/metrics-server/pkg/sources"
+)
+
+func nodeBatch(node string, cpu int64, ts time.Time) *sources.MetricsBatch {
+	return &sources.MetricsBatch{
+		Nodes: []sources.NodeMetricsPoint{{Name: node, Timestamp: ts, CpuUsage: cpu, MemoryUsage: cpu}},
+	}
+}
+
+func TestRingBufferSinkEvictsOldestWhenFull(t *testing.T) {
+	sink := NewRingBufferSink(2).(*ringBufferSink)
+
+	base := time.Now().Add(-time.Hour)
+	sink.Receive(nodeBatch("node-1", 1, base))
+	sink.Receive(nodeBatch("node-1", 2, base.Add(time.Minute)))
+	sink.Receive(nodeBatch("node-1", 3, base.Add(2*time.Minute)))
+
+	points := sink.NodeRange("node-1", 24*time.Hour)
+	if len(points) != 2 {
+		t.Fatalf("expected capacity to cap retained points at 2, got %d", len(points))
+	}
+	var usages []int64
+	for _, p := range points {
+		usages = append(usages, p.CpuUsage)
+	}
+	if usages[0] != 2 || usages[1] != 3 {
+		t.Fatalf("expected the oldest sample to be evicted (want [2 3]), got %v", usages)
+	}
+}
+
+func TestRingBufferSinkNodeRangeFiltersBySince(t *testing.T) {
+	sink := NewRingBufferSink(10).(*ringBufferSink)
+
+	now := time.Now()
+	sink.Receive(nodeBatch("node-1", 1, now.Add(-2*time.Hour)))
+	sink.Receive(nodeBatch("node-1", 2, now.Add(-time.Minute)))
+
+	points := sink.NodeRange("node-1", 10*time.Minute)
+	if len(points) != 1 {
+		t.Fatalf("expected only the recent sample within the window, got %d", len(points))
+	}
+	if points[0].CpuUsage != 2 {
+		t.Fatalf("expected the recent sample (CpuUsage=2), got %d", points[0].CpuUsage)
+	}
+}
+
+func TestRingBufferSinkPodRangeFiltersByNamespaceAndName(t *testing.T) {
+	sink := NewRingBufferSink(10).(*ringBufferSink)
+
+	now := time.Now()
+	batch := &sources.MetricsBatch{
+		Pods: []sources.PodMetricsPoint{
+			{
+				Name:      "pod-a",
+				Namespace: "ns",
+				Containers: []sources.ContainerMetricsPoint{
+					{Name: "c1", Timestamp: now, CpuUsage: 5, MemoryUsage: 5},
+				},
+			},
+			{
+				Name:      "pod-b",
+				Namespace: "ns",
+				Containers: []sources.ContainerMetricsPoint{
+					{Name: "c1", Timestamp: now, CpuUsage: 9, MemoryUsage: 9},
+				},
+			},
+		},
+	}
+	sink.Receive(batch)
+
+	points := sink.PodRange("ns", "pod-a", time.Hour)
+	if len(points) != 1 {
+		t.Fatalf("expected exactly one point for pod-a, got %d", len(points))
+	}
+	if points[0].CpuUsage != 5 {
+		t.Fatalf("expected pod-a's own sample (CpuUsage=5), got %d", points[0].CpuUsage)
+	}
+}
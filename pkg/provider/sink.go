@@ -0,0 +1,59 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"time"
+
+	"github.com/kubernetes-incubator/metrics-server/pkg/sources"
+)
+
+// Sink receives each MetricsBatch the manager collects and makes it
+// available to the provider(s) serving metrics.k8s.io. NewSinkProvider's
+// always-in-memory single-point sink is the simplest implementation;
+// NewRingBufferSink and NewRemoteWriteSink in this package offer retention
+// and off-cluster durability respectively.
+type Sink interface {
+	// Receive stores a freshly-collected batch. It must be safe to call
+	// from the manager's scrape goroutine concurrently with reads made by
+	// whatever is backing the metrics.k8s.io provider.
+	Receive(batch *sources.MetricsBatch)
+}
+
+// RangeQueryable is implemented by sinks that retain more than the latest
+// sample, so the API layer can serve `since`/`step` range queries instead of
+// only the most recent point.
+type RangeQueryable interface {
+	// NodeRange returns the retained samples for node between since and now.
+	NodeRange(node string, since time.Duration) []NodeMetricsPoint
+	// PodRange returns the retained samples for the named pod's containers
+	// between since and now.
+	PodRange(namespace, name string, since time.Duration) []PodMetricsPoint
+}
+
+// NodeMetricsPoint is a single retained sample for a node.
+type NodeMetricsPoint struct {
+	Timestamp time.Time
+	CpuUsage  int64
+	MemUsage  int64
+}
+
+// PodMetricsPoint is a single retained sample for one container of a pod.
+type PodMetricsPoint struct {
+	Timestamp     time.Time
+	ContainerName string
+	CpuUsage      int64
+	MemUsage      int64
+}
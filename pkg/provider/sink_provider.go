@@ -0,0 +1,109 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	apitypes "k8s.io/apimachinery/pkg/types"
+)
+
+// sinceBeginningOfTime is passed to a RangeQueryable sink to retrieve every
+// retained sample for a node/pod, so the latest one (the last entry, since
+// sinks append in collection order) can be picked off.
+const sinceBeginningOfTime = 100 * 365 * 24 * time.Hour
+
+// sinkMetricsProvider adapts an arbitrary Sink to MetricsProvider by reading
+// back the most recently received sample for each requested node/pod. It
+// only has anything to serve for sinks that also implement RangeQueryable;
+// a sink that doesn't (e.g. a pure remote-write forwarder with no local
+// retention) simply has nothing local to read, which this reports as an
+// empty result rather than an error.
+type sinkMetricsProvider struct {
+	sink Sink
+}
+
+// newSinkMetricsProvider builds the MetricsProvider NewProvider hands back
+// alongside the caller's own sink.
+func newSinkMetricsProvider(sink Sink) MetricsProvider {
+	return &sinkMetricsProvider{sink: sink}
+}
+
+func (p *sinkMetricsProvider) GetNodeMetrics(nodes ...string) ([]TimeInfo, []ResourceList, error) {
+	times := make([]TimeInfo, len(nodes))
+	values := make([]ResourceList, len(nodes))
+
+	ranged, ok := p.sink.(RangeQueryable)
+	if !ok {
+		return times, values, nil
+	}
+
+	for i, node := range nodes {
+		points := ranged.NodeRange(node, sinceBeginningOfTime)
+		if len(points) == 0 {
+			continue
+		}
+		latest := points[len(points)-1]
+		times[i] = TimeInfo{Timestamp: latest.Timestamp}
+		values[i] = resourceList(latest.CpuUsage, latest.MemUsage)
+	}
+	return times, values, nil
+}
+
+func (p *sinkMetricsProvider) GetContainerMetrics(pods ...apitypes.NamespacedName) ([]TimeInfo, [][]ResourceList, error) {
+	times := make([]TimeInfo, len(pods))
+	values := make([][]ResourceList, len(pods))
+
+	ranged, ok := p.sink.(RangeQueryable)
+	if !ok {
+		return times, values, nil
+	}
+
+	for i, pod := range pods {
+		points := ranged.PodRange(pod.Namespace, pod.Name, sinceBeginningOfTime)
+		latestByContainer := map[string]PodMetricsPoint{}
+		for _, point := range points {
+			if existing, ok := latestByContainer[point.ContainerName]; !ok || point.Timestamp.After(existing.Timestamp) {
+				latestByContainer[point.ContainerName] = point
+			}
+		}
+		if len(latestByContainer) == 0 {
+			continue
+		}
+
+		var latestTimestamp time.Time
+		containerValues := make([]ResourceList, 0, len(latestByContainer))
+		for _, point := range latestByContainer {
+			containerValues = append(containerValues, resourceList(point.CpuUsage, point.MemUsage))
+			if point.Timestamp.After(latestTimestamp) {
+				latestTimestamp = point.Timestamp
+			}
+		}
+		times[i] = TimeInfo{Timestamp: latestTimestamp}
+		values[i] = containerValues
+	}
+	return times, values, nil
+}
+
+// resourceList builds a v1.ResourceList from the nanocore CPU usage and
+// byte memory usage every sink already stores its samples as.
+func resourceList(cpuNanocores, memoryBytes int64) ResourceList {
+	return v1.ResourceList{
+		v1.ResourceCPU:    *resource.NewScaledQuantity(cpuNanocores, resource.Nano),
+		v1.ResourceMemory: *resource.NewQuantity(memoryBytes, resource.BinarySI),
+	}
+}
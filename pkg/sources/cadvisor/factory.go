@@ -0,0 +1,51 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cadvisor
+
+import (
+	"github.com/kubernetes-incubator/metrics-server/pkg/sources"
+)
+
+// Endpoint is the kubelet-relative path the cadvisor provider scrapes.
+// Flag-configurable via --cadvisor-endpoint in cmd/metrics-server/app.
+var Endpoint = "/metrics/cadvisor"
+
+// KubeletPort and Insecure mirror summary.KubeletPort/--kubelet-insecure: the
+// cadvisor provider scrapes the same kubelet the summary API would, so it
+// reuses the same --kubelet-port/--kubelet-insecure flags rather than
+// introducing its own.
+var (
+	KubeletPort = 10250
+	Insecure    = false
+)
+
+type factory struct{}
+
+func (factory) Name() string {
+	return "cadvisor"
+}
+
+func (factory) NewSourceProvider(cfg sources.ProviderFactoryConfig) (sources.MetricsSourceProvider, error) {
+	nodes := cfg.Nodes()
+	client, err := newHTTPClient(cfg.ClientConfig, Endpoint, KubeletPort, Insecure)
+	if err != nil {
+		return nil, err
+	}
+	return NewCadvisorProvider(nodes, client), nil
+}
+
+func init() {
+	sources.RegisterSourceProviderFactory(factory{})
+}
@@ -0,0 +1,73 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cadvisor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/transport"
+)
+
+// httpClient scrapes Endpoint on each node directly, reusing the TLS and
+// bearer-token settings metrics-server already has configured for talking
+// to the summary API's kubelet connections.
+type httpClient struct {
+	endpoint string
+	port     int
+	scheme   string
+	client   *http.Client
+}
+
+func newHTTPClient(clientConfig *rest.Config, endpoint string, port int, insecure bool) (*httpClient, error) {
+	rt, err := transport.New(clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to build HTTP transport for cadvisor scraping: %v", err)
+	}
+
+	scheme := "https"
+	if insecure {
+		scheme = "http"
+	}
+
+	return &httpClient{
+		endpoint: endpoint,
+		port:     port,
+		scheme:   scheme,
+		client:   &http.Client{Transport: rt},
+	}, nil
+}
+
+func (c *httpClient) GetCAdvisorMetrics(ctx context.Context, nodeAddress string) (io.ReadCloser, error) {
+	url := fmt.Sprintf("%s://%s:%d%s", c.scheme, nodeAddress, c.port, c.endpoint)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("cadvisor scrape of %s returned status %d", url, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,210 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cadvisor implements a MetricsSourceProvider that scrapes the
+// kubelet's Prometheus-formatted `/metrics/cadvisor` endpoint instead of the
+// `/stats/summary` API, for clusters where the summary API is disabled or
+// known to diverge from cAdvisor's own counters.
+package cadvisor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	v1 "k8s.io/api/core/v1"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/kubernetes-incubator/metrics-server/pkg/sources"
+)
+
+const (
+	cpuUsageMetric    = "container_cpu_usage_seconds_total"
+	memoryUsageMetric = "container_memory_working_set_bytes"
+
+	labelPodName      = "pod"
+	labelPodNamespace = "namespace"
+	labelContainer    = "container"
+)
+
+// Client fetches the raw Prometheus exposition served at a single node's
+// `/metrics/cadvisor` endpoint. It is abstracted so tests can stub out the
+// HTTP round trip.
+type Client interface {
+	GetCAdvisorMetrics(ctx context.Context, nodeAddress string) (io.ReadCloser, error)
+}
+
+type provider struct {
+	nodeLister v1listers.NodeLister
+	client     Client
+}
+
+// NewCadvisorProvider constructs a sources.MetricsSourceProvider that scrapes
+// container_cpu_usage_seconds_total and container_memory_working_set_bytes
+// off of each node's cAdvisor endpoint and reassembles them into the same
+// sources.MetricsBatch shape the summary provider produces.
+func NewCadvisorProvider(nodeLister v1listers.NodeLister, client Client) sources.MetricsSourceProvider {
+	return &provider{nodeLister: nodeLister, client: client}
+}
+
+func (p *provider) GetMetricSources() []sources.MetricsSource {
+	nodes, err := p.nodeLister.List(labels.Everything())
+	if err != nil {
+		return nil
+	}
+	sourcesList := make([]sources.MetricsSource, 0, len(nodes))
+	for _, node := range nodes {
+		sourcesList = append(sourcesList, &cadvisorSource{node: node, client: p.client})
+	}
+	return sourcesList
+}
+
+type cadvisorSource struct {
+	node   *v1.Node
+	client Client
+}
+
+func (s *cadvisorSource) Name() string {
+	return fmt.Sprintf("cadvisor:%s", s.node.Name)
+}
+
+// nodeAddress picks the node's InternalIP, falling back to Hostname, the
+// same preference order the summary kubelet client uses.
+func nodeAddress(node *v1.Node) (string, error) {
+	for _, addressType := range []v1.NodeAddressType{v1.NodeInternalIP, v1.NodeHostName} {
+		for _, addr := range node.Status.Addresses {
+			if addr.Type == addressType {
+				return addr.Address, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("node %s has no usable addresses", node.Name)
+}
+
+func (s *cadvisorSource) Collect(ctx context.Context) (*sources.MetricsBatch, error) {
+	address, err := nodeAddress(s.node)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve address for node %s: %v", s.node.Name, err)
+	}
+
+	body, err := s.client.GetCAdvisorMetrics(ctx, address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch cadvisor metrics for node %s: %v", s.node.Name, err)
+	}
+	defer body.Close()
+
+	parser := expfmt.TextParser{}
+	families, err := parser.TextToMetricFamilies(body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode cadvisor metrics for node %s: %v", s.node.Name, err)
+	}
+
+	return batchFromFamilies(s.node.Name, families, time.Now()), nil
+}
+
+// containerKey identifies a single container's row across both the CPU and
+// memory metric families so their samples can be merged into one point.
+type containerKey struct {
+	namespace string
+	pod       string
+	container string
+}
+
+func batchFromFamilies(nodeName string, families map[string]*dto.MetricFamily, timestamp time.Time) *sources.MetricsBatch {
+	points := map[containerKey]*sources.ContainerMetricsPoint{}
+	var nodeCPU, nodeMemory int64
+
+	for _, name := range []string{cpuUsageMetric, memoryUsageMetric} {
+		family, ok := families[name]
+		if !ok {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			key, ok := keyFromLabels(metric.GetLabel())
+			if !ok {
+				// Skip pod-sandbox/aggregate rows that carry no container label.
+				continue
+			}
+			point, ok := points[key]
+			if !ok {
+				point = &sources.ContainerMetricsPoint{Name: key.container, Timestamp: timestamp}
+				points[key] = point
+			}
+			applySample(point, name, metric)
+		}
+	}
+
+	// cAdvisor's own machine-level row (an empty/"/" cgroup) isn't exposed
+	// consistently across container runtimes, so the node-level point is
+	// synthesized as the sum of every container's usage on this node. This
+	// mirrors what the summary API's node-level usage already approximates
+	// from its own per-pod totals.
+	for _, point := range points {
+		nodeCPU += point.CpuUsage
+		nodeMemory += point.MemoryUsage
+	}
+
+	batch := &sources.MetricsBatch{
+		Nodes: []sources.NodeMetricsPoint{{
+			Name:        nodeName,
+			Timestamp:   timestamp,
+			CpuUsage:    nodeCPU,
+			MemoryUsage: nodeMemory,
+		}},
+	}
+	byPod := map[containerKey][]sources.ContainerMetricsPoint{}
+	for key, point := range points {
+		podKey := containerKey{namespace: key.namespace, pod: key.pod}
+		byPod[podKey] = append(byPod[podKey], *point)
+	}
+	for podKey, containers := range byPod {
+		batch.Pods = append(batch.Pods, sources.PodMetricsPoint{
+			Name:       podKey.pod,
+			Namespace:  podKey.namespace,
+			Containers: containers,
+		})
+	}
+	return batch
+}
+
+func keyFromLabels(labelPairs []*dto.LabelPair) (containerKey, bool) {
+	var key containerKey
+	for _, l := range labelPairs {
+		switch l.GetName() {
+		case labelPodName:
+			key.pod = l.GetValue()
+		case labelPodNamespace:
+			key.namespace = l.GetValue()
+		case labelContainer:
+			key.container = l.GetValue()
+		}
+	}
+	return key, key.container != "" && key.pod != ""
+}
+
+func applySample(point *sources.ContainerMetricsPoint, metricName string, metric *dto.Metric) {
+	switch metricName {
+	case cpuUsageMetric:
+		// container_cpu_usage_seconds_total is a cumulative counter in
+		// core-seconds; the source manager diffs successive batches into a
+		// rate, same as it already does for the summary API's UsageNanoCores.
+		point.CpuUsage = int64(metric.GetCounter().GetValue() * 1e9)
+	case memoryUsageMetric:
+		point.MemoryUsage = int64(metric.GetGauge().GetValue())
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cri
+
+import (
+	"net"
+	"strings"
+	"time"
+)
+
+// dialUnix is a grpc.WithDialer dialer that strips the "unix://" prefix CRI
+// endpoints are conventionally written with before dialing the socket.
+func dialUnix(addr string, timeout time.Duration) (net.Conn, error) {
+	addr = strings.TrimPrefix(addr, "unix://")
+	return net.DialTimeout("unix", addr, timeout)
+}
@@ -0,0 +1,59 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cri
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kubernetes-incubator/metrics-server/pkg/sources"
+)
+
+// Endpoint is the CRI runtime unix socket the cri provider dials.
+// Flag-configurable via --cri-endpoint in cmd/metrics-server/app.
+var Endpoint = DefaultRuntimeEndpoint
+
+// DialTimeout bounds how long NewSourceProvider waits for the runtime socket
+// to accept a connection before giving up.
+const DialTimeout = 5 * time.Second
+
+type factory struct{}
+
+func (factory) Name() string {
+	return "cri"
+}
+
+func (factory) NewSourceProvider(cfg sources.ProviderFactoryConfig) (sources.MetricsSourceProvider, error) {
+	client, _, err := NewRuntimeClient(Endpoint, DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	// The CRI source is named "cri:<node>" and matched against the
+	// Kubernetes Node it's scraping (see sources.findSourceForNode), so it
+	// needs the registered Node name, not this pod's hostname -- those only
+	// coincide by accident. NODE_NAME is expected to be bound to
+	// spec.nodeName via the downward API in the DaemonSet pod spec, the
+	// same convention kubelet's own addon pods use.
+	nodeName := os.Getenv("NODE_NAME")
+	if nodeName == "" {
+		return nil, fmt.Errorf("--metric-source=cri requires the NODE_NAME environment variable to be set (e.g. via the downward API's spec.nodeName)")
+	}
+	return NewCRIProvider(nodeName, client), nil
+}
+
+func init() {
+	sources.RegisterSourceProviderFactory(factory{})
+}
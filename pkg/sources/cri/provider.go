@@ -0,0 +1,136 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cri implements a MetricsSourceProvider backed directly by the
+// container runtime's CRI StatsService, for nodes where neither the summary
+// API nor cAdvisor's Prometheus endpoint is available.
+package cri
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+
+	"github.com/kubernetes-incubator/metrics-server/pkg/sources"
+)
+
+// DefaultRuntimeEndpoint matches the dockershim/containerd/CRI-O convention
+// of a well-known unix socket for the node-local CRI runtime.
+const DefaultRuntimeEndpoint = "unix:///var/run/dockershim.sock"
+
+// NewRuntimeClient dials the CRI runtime endpoint (a unix socket, per the
+// `--cri-endpoint` flag) and returns a RuntimeServiceClient used to pull
+// container stats directly from the runtime.
+func NewRuntimeClient(endpoint string, timeout time.Duration) (runtimeapi.RuntimeServiceClient, *grpc.ClientConn, error) {
+	conn, err := grpc.Dial(endpoint,
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+		grpc.WithTimeout(timeout),
+		grpc.WithDialer(dialUnix),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to connect to CRI runtime endpoint %q: %v", endpoint, err)
+	}
+	return runtimeapi.NewRuntimeServiceClient(conn), conn, nil
+}
+
+type provider struct {
+	nodeName string
+	client   runtimeapi.RuntimeServiceClient
+}
+
+// NewCRIProvider constructs a sources.MetricsSourceProvider that reports a
+// single MetricsSource for the local node's runtime. Unlike the summary and
+// cadvisor providers it cannot be pointed at other nodes' endpoints, since
+// the CRI socket is only ever node-local; metrics-server runs one replica of
+// this source per DaemonSet pod when `--metric-source=cri` is selected.
+func NewCRIProvider(nodeName string, client runtimeapi.RuntimeServiceClient) sources.MetricsSourceProvider {
+	return &provider{nodeName: nodeName, client: client}
+}
+
+func (p *provider) GetMetricSources() []sources.MetricsSource {
+	return []sources.MetricsSource{&criSource{nodeName: p.nodeName, client: p.client}}
+}
+
+type criSource struct {
+	nodeName string
+	client   runtimeapi.RuntimeServiceClient
+}
+
+func (s *criSource) Name() string {
+	return fmt.Sprintf("cri:%s", s.nodeName)
+}
+
+func (s *criSource) Collect(ctx context.Context) (*sources.MetricsBatch, error) {
+	resp, err := s.client.ListContainerStats(ctx, &runtimeapi.ListContainerStatsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list container stats from CRI runtime on node %s: %v", s.nodeName, err)
+	}
+
+	byPod := map[string][]sources.ContainerMetricsPoint{}
+	podMeta := map[string]sources.PodMetricsPoint{}
+	timestamp := time.Now()
+
+	for _, stat := range resp.GetStats() {
+		attrs := stat.GetAttributes()
+		labels := attrs.GetLabels()
+		podName := labels["io.kubernetes.pod.name"]
+		podNamespace := labels["io.kubernetes.pod.namespace"]
+		podUID := labels["io.kubernetes.pod.uid"]
+		if podName == "" {
+			continue
+		}
+
+		point := sources.ContainerMetricsPoint{
+			Name:      attrs.GetMetadata().GetName(),
+			Timestamp: timestamp,
+		}
+		if cpu := stat.GetCpu(); cpu != nil {
+			point.CpuUsage = int64(cpu.GetUsageCoreNanoSeconds().GetValue())
+		}
+		if mem := stat.GetMemory(); mem != nil {
+			point.MemoryUsage = int64(mem.GetWorkingSetBytes().GetValue())
+		}
+
+		byPod[podUID] = append(byPod[podUID], point)
+		podMeta[podUID] = sources.PodMetricsPoint{Name: podName, Namespace: podNamespace}
+	}
+
+	var nodeCPU, nodeMemory int64
+	batch := &sources.MetricsBatch{}
+	for podUID, containers := range byPod {
+		meta := podMeta[podUID]
+		meta.Containers = containers
+		batch.Pods = append(batch.Pods, meta)
+
+		for _, container := range containers {
+			nodeCPU += container.CpuUsage
+			nodeMemory += container.MemoryUsage
+		}
+	}
+
+	// The CRI StatsService has no machine-level row of its own, so (as with
+	// the cadvisor provider) the node-level point is synthesized as the sum
+	// of every container's usage reported for this node.
+	batch.Nodes = []sources.NodeMetricsPoint{{
+		Name:        s.nodeName,
+		Timestamp:   timestamp,
+		CpuUsage:    nodeCPU,
+		MemoryUsage: nodeMemory,
+	}}
+	return batch, nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/informers"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+// ProviderFactoryConfig bundles the pieces a SourceProviderFactory needs to
+// build a MetricsSourceProvider: the client config used to reach the API
+// server (and, transitively, the kubelets), and the shared informer factory
+// metrics-server already runs for node/pod listing.
+type ProviderFactoryConfig struct {
+	ClientConfig    *rest.Config
+	InformerFactory informers.SharedInformerFactory
+
+	// NodeLister, when set, is used in place of
+	// InformerFactory.Core().V1().Nodes().Lister(). This lets callers (e.g.
+	// the sharding subsystem) restrict a factory to a subset of nodes
+	// without every factory needing its own sharding awareness.
+	NodeLister v1listers.NodeLister
+}
+
+// Nodes returns cfg.NodeLister if set, falling back to the shared informer
+// factory's node lister otherwise.
+func (cfg ProviderFactoryConfig) Nodes() v1listers.NodeLister {
+	if cfg.NodeLister != nil {
+		return cfg.NodeLister
+	}
+	return cfg.InformerFactory.Core().V1().Nodes().Lister()
+}
+
+// SourceProviderFactory knows how to construct a MetricsSourceProvider for a
+// single `--metric-source` value (e.g. "summary", "cadvisor", "cri"). The
+// per-source flags are registered by cmd/metrics-server/app, which copies
+// their values into the provider packages' exported variables before
+// NewSourceProvider is called.
+type SourceProviderFactory interface {
+	// Name is the value users pass to --metric-source to select this provider.
+	Name() string
+	// NewSourceProvider constructs the provider using previously-parsed flags.
+	NewSourceProvider(cfg ProviderFactoryConfig) (MetricsSourceProvider, error)
+}
+
+var factories = map[string]SourceProviderFactory{}
+
+// RegisterSourceProviderFactory makes a SourceProviderFactory available under
+// its Name() for later lookup via SourceProviderFactoryFor. It is expected to
+// be called from package init() functions of the concrete providers.
+func RegisterSourceProviderFactory(f SourceProviderFactory) {
+	factories[f.Name()] = f
+}
+
+// SourceProviderFactoryFor looks up a previously-registered factory by name.
+func SourceProviderFactoryFor(name string) (SourceProviderFactory, error) {
+	f, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric source %q", name)
+	}
+	return f, nil
+}
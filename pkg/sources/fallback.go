@@ -0,0 +1,153 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/kubernetes-incubator/metrics-server/pkg/metrics"
+)
+
+// fallbackProvider chains several MetricsSourceProviders together. Unlike a
+// naive "use whichever provider lists any sources" selection, it picks a
+// winner per node and per scrape: every configured provider's source for a
+// given node is tried, in order, until one Collect succeeds, so a later
+// --metric-source is only ever skipped when an earlier one is actually
+// working for that node.
+type fallbackProvider struct {
+	nodeLister v1listers.NodeLister
+	providers  []MetricsSourceProvider
+}
+
+// NewFallbackProvider returns a MetricsSourceProvider that scrapes every
+// node in nodeLister, trying each of providers in order and falling back to
+// the next one only when Collect for the current node actually fails.
+func NewFallbackProvider(nodeLister v1listers.NodeLister, providers ...MetricsSourceProvider) MetricsSourceProvider {
+	return &fallbackProvider{nodeLister: nodeLister, providers: providers}
+}
+
+func (p *fallbackProvider) GetMetricSources() []MetricsSource {
+	if len(p.providers) == 1 {
+		// Nothing to fall back to: skip the per-node matching machinery and
+		// hand back the single provider's sources, still instrumented.
+		sourcesList := p.providers[0].GetMetricSources()
+		instrumented := make([]MetricsSource, len(sourcesList))
+		for i, src := range sourcesList {
+			instrumented[i] = instrumentSource(src)
+		}
+		return instrumented
+	}
+
+	nodes, err := p.nodeLister.List(labels.Everything())
+	if err != nil {
+		return nil
+	}
+
+	perProvider := make([][]MetricsSource, len(p.providers))
+	for i, provider := range p.providers {
+		perProvider[i] = provider.GetMetricSources()
+	}
+
+	sourcesList := make([]MetricsSource, 0, len(nodes))
+	for _, node := range nodes {
+		var candidates []MetricsSource
+		for _, sources := range perProvider {
+			if src := findSourceForNode(sources, node.Name); src != nil {
+				candidates = append(candidates, instrumentSource(src))
+			}
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+		sourcesList = append(sourcesList, &fallbackSource{node: node.Name, candidates: candidates})
+	}
+	return sourcesList
+}
+
+// findSourceForNode locates the MetricsSource among sources that scrapes
+// node. Providers are expected to name their per-node sources
+// "<source>:<node>" (e.g. "cadvisor:<node>", "summary:<node>"), which every
+// in-tree provider does; the node segment is compared for exact equality so
+// e.g. "node-1" doesn't also match a source named "cadvisor:node-11".
+func findSourceForNode(sources []MetricsSource, node string) MetricsSource {
+	for _, src := range sources {
+		if _, srcNode := splitSourceName(src.Name()); srcNode == node {
+			return src
+		}
+	}
+	return nil
+}
+
+// fallbackSource tries each of its candidates' Collect, in order, for a
+// single node, returning the first successful MetricsBatch.
+type fallbackSource struct {
+	node       string
+	candidates []MetricsSource
+}
+
+func (s *fallbackSource) Name() string {
+	return fmt.Sprintf("fallback:%s", s.node)
+}
+
+func (s *fallbackSource) Collect(ctx context.Context) (*MetricsBatch, error) {
+	var lastErr error
+	for _, candidate := range s.candidates {
+		batch, err := candidate.Collect(ctx)
+		if err == nil {
+			return batch, nil
+		}
+		lastErr = fmt.Errorf("%s: %v", candidate.Name(), err)
+	}
+	return nil, fmt.Errorf("all metric sources failed for node %s: %v", s.node, lastErr)
+}
+
+// instrumentedSource wraps a MetricsSource to record metrics.ScrapeDuration
+// and metrics.ScrapeErrorsTotal around every Collect call, so --metric-source
+// scrape health shows up on the operational /metrics endpoint regardless of
+// which (or how many) providers are configured.
+type instrumentedSource struct {
+	MetricsSource
+}
+
+func instrumentSource(src MetricsSource) MetricsSource {
+	return &instrumentedSource{MetricsSource: src}
+}
+
+func (s *instrumentedSource) Collect(ctx context.Context) (*MetricsBatch, error) {
+	source, node := splitSourceName(s.Name())
+	start := time.Now()
+	batch, err := s.MetricsSource.Collect(ctx)
+	metrics.ScrapeDuration.WithLabelValues(source, node).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.ScrapeErrorsTotal.WithLabelValues(source, node).Inc()
+	}
+	return batch, err
+}
+
+// splitSourceName splits a "<source>:<node>" Name() into its two parts,
+// falling back to treating the whole name as the source with no node label.
+func splitSourceName(name string) (source, node string) {
+	parts := strings.SplitN(name, ":", 2)
+	if len(parts) != 2 {
+		return name, ""
+	}
+	return parts[0], parts[1]
+}
@@ -0,0 +1,184 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sources
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// fakeNodeLister implements v1listers.NodeLister over a fixed node list.
+type fakeNodeLister struct {
+	nodes []*v1.Node
+}
+
+func (f fakeNodeLister) List(selector labels.Selector) ([]*v1.Node, error) {
+	return f.nodes, nil
+}
+
+func (f fakeNodeLister) Get(name string) (*v1.Node, error) {
+	for _, n := range f.nodes {
+		if n.Name == name {
+			return n, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func node(name string) *v1.Node {
+	return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+}
+
+// stubSource is a MetricsSource whose Name and Collect behavior are fixed at
+// construction time, so tests can assert fallback picks the right winner.
+type stubSource struct {
+	name  string
+	batch *MetricsBatch
+	err   error
+}
+
+func (s *stubSource) Name() string { return s.name }
+
+func (s *stubSource) Collect(ctx context.Context) (*MetricsBatch, error) {
+	return s.batch, s.err
+}
+
+// stubProvider is a MetricsSourceProvider that always returns the same fixed
+// set of sources, regardless of whether those sources can actually Collect.
+type stubProvider struct {
+	sources []MetricsSource
+}
+
+func (p *stubProvider) GetMetricSources() []MetricsSource { return p.sources }
+
+func TestFallbackProviderFallsBackOnCollectFailure(t *testing.T) {
+	lister := fakeNodeLister{nodes: []*v1.Node{node("node-1")}}
+
+	primaryBatch := &MetricsBatch{}
+	primary := &stubProvider{sources: []MetricsSource{
+		&stubSource{name: "primary:node-1", err: errors.New("connection refused")},
+	}}
+	secondary := &stubProvider{sources: []MetricsSource{
+		&stubSource{name: "secondary:node-1", batch: primaryBatch},
+	}}
+
+	provider := NewFallbackProvider(lister, primary, secondary)
+	metricsSources := provider.GetMetricSources()
+	if len(metricsSources) != 1 {
+		t.Fatalf("expected exactly one fallback source, got %d", len(metricsSources))
+	}
+
+	batch, err := metricsSources[0].Collect(context.Background())
+	if err != nil {
+		t.Fatalf("expected fallback to secondary to succeed, got error: %v", err)
+	}
+	if batch != primaryBatch {
+		t.Fatalf("expected secondary provider's batch, got a different batch")
+	}
+}
+
+func TestFallbackProviderPrefersEarlierProviderOnSuccess(t *testing.T) {
+	lister := fakeNodeLister{nodes: []*v1.Node{node("node-1")}}
+
+	wantBatch := &MetricsBatch{}
+	primary := &stubProvider{sources: []MetricsSource{
+		&stubSource{name: "primary:node-1", batch: wantBatch},
+	}}
+	secondary := &stubProvider{sources: []MetricsSource{
+		&stubSource{name: "secondary:node-1", err: errors.New("should never be tried")},
+	}}
+
+	provider := NewFallbackProvider(lister, primary, secondary)
+	batch, err := provider.GetMetricSources()[0].Collect(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if batch != wantBatch {
+		t.Fatalf("expected primary provider's batch when primary succeeds")
+	}
+}
+
+func TestFallbackProviderAllSourcesFail(t *testing.T) {
+	lister := fakeNodeLister{nodes: []*v1.Node{node("node-1")}}
+
+	primary := &stubProvider{sources: []MetricsSource{
+		&stubSource{name: "primary:node-1", err: errors.New("boom")},
+	}}
+	secondary := &stubProvider{sources: []MetricsSource{
+		&stubSource{name: "secondary:node-1", err: errors.New("also boom")},
+	}}
+
+	provider := NewFallbackProvider(lister, primary, secondary)
+	_, err := provider.GetMetricSources()[0].Collect(context.Background())
+	if err == nil {
+		t.Fatalf("expected an error when every candidate source fails")
+	}
+}
+
+func TestFallbackProviderSkipsNodesWithNoSource(t *testing.T) {
+	lister := fakeNodeLister{nodes: []*v1.Node{node("node-1"), node("node-2")}}
+
+	primary := &stubProvider{sources: []MetricsSource{
+		&stubSource{name: "primary:node-1", batch: &MetricsBatch{}},
+	}}
+
+	provider := NewFallbackProvider(lister, primary)
+	metricsSources := provider.GetMetricSources()
+	if len(metricsSources) != 1 {
+		t.Fatalf("expected only node-1 to have a source, got %d sources", len(metricsSources))
+	}
+	if metricsSources[0].Name() != "primary:node-1" {
+		t.Fatalf("single-provider case should return the provider's own source, not a fallback source, got %q", metricsSources[0].Name())
+	}
+}
+
+func TestFallbackProviderDoesNotMatchNodeNameSubstrings(t *testing.T) {
+	lister := fakeNodeLister{nodes: []*v1.Node{node("node-1"), node("node-11")}}
+
+	node1Batch := &MetricsBatch{}
+	node11Batch := &MetricsBatch{}
+	primary := &stubProvider{sources: []MetricsSource{
+		&stubSource{name: "primary:node-1", batch: node1Batch},
+		&stubSource{name: "primary:node-11", batch: node11Batch},
+	}}
+	secondary := &stubProvider{sources: []MetricsSource{}}
+
+	provider := NewFallbackProvider(lister, primary, secondary)
+	byName := map[string]MetricsSource{}
+	for _, src := range provider.GetMetricSources() {
+		byName[src.Name()] = src
+	}
+
+	batch, err := byName["fallback:node-1"].Collect(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error collecting node-1: %v", err)
+	}
+	if batch != node1Batch {
+		t.Fatalf("node-1 should be matched to its own source, not node-11's")
+	}
+
+	batch, err = byName["fallback:node-11"].Collect(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error collecting node-11: %v", err)
+	}
+	if batch != node11Batch {
+		t.Fatalf("node-11 should be matched to its own source, not node-1's")
+	}
+}
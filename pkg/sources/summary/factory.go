@@ -0,0 +1,49 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package summary
+
+import (
+	"fmt"
+
+	"github.com/kubernetes-incubator/metrics-server/pkg/sources"
+)
+
+// KubeletPort is the port the summary provider's kubelet client connects to.
+// Flag-configurable via --kubelet-port in cmd/metrics-server/app.
+var KubeletPort = 10250
+
+// KubeletScrapeMode selects how the kubelet client reaches each node.
+// Flag-configurable via --kubelet-scrape-mode in cmd/metrics-server/app.
+var KubeletScrapeMode = ScrapeModeDirect
+
+type factory struct{}
+
+func (factory) Name() string {
+	return "summary"
+}
+
+func (factory) NewSourceProvider(cfg sources.ProviderFactoryConfig) (sources.MetricsSourceProvider, error) {
+	kubeletConfig := GetKubeletConfig(cfg.ClientConfig, KubeletPort)
+	kubeletClient, err := KubeletClientForMode(KubeletScrapeMode, kubeletConfig, cfg.ClientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to construct a client to connect to the kubelets: %v", err)
+	}
+	nodes := cfg.Nodes()
+	return NewSummaryProvider(nodes, kubeletClient), nil
+}
+
+func init() {
+	sources.RegisterSourceProviderFactory(factory{})
+}
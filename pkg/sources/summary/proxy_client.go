@@ -0,0 +1,92 @@
+// Copyright 2018 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package summary
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// ScrapeMode selects how the summary provider's kubelet client reaches each
+// node: a direct connection to the kubelet's own port, or a proxied
+// connection through the API server for clusters where the kubelet's
+// read-only/insecure port is disabled or node IPs aren't reachable from the
+// metrics-server pod.
+type ScrapeMode string
+
+const (
+	// ScrapeModeDirect dials KubeletPort on the node's address directly.
+	// This is the historical, default behavior.
+	ScrapeModeDirect ScrapeMode = "direct"
+	// ScrapeModeAPIProxy routes scrapes through
+	// /api/v1/nodes/{name}/proxy/stats/summary using clientConfig, so no
+	// direct network path to the kubelet is required.
+	ScrapeModeAPIProxy ScrapeMode = "api-proxy"
+)
+
+// proxyKubeletClient implements KubeletInterface by issuing requests through
+// the API server's node proxy subresource instead of dialing the kubelet
+// directly. It is selected with --kubelet-scrape-mode=api-proxy.
+type proxyKubeletClient struct {
+	client *kubernetes.Clientset
+}
+
+// NewProxyKubeletClient builds a KubeletInterface that scrapes
+// /stats/summary via the API server's `nodes/{name}/proxy` subresource,
+// using clientConfig for both authentication and connectivity. Unlike
+// KubeletClientFor, it never opens a connection to the node directly.
+func NewProxyKubeletClient(clientConfig *rest.Config) (KubeletInterface, error) {
+	client, err := kubernetes.NewForConfig(clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to construct client for kubelet API-proxy scraping: %v", err)
+	}
+	return &proxyKubeletClient{client: client}, nil
+}
+
+func (c *proxyKubeletClient) GetSummary(ctx context.Context, node string) (*Summary, error) {
+	data, err := c.client.CoreV1().RESTClient().Get().
+		Resource("nodes").
+		Name(node).
+		SubResource("proxy").
+		Suffix("stats/summary").
+		DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch stats/summary for node %s via API proxy: %v", node, err)
+	}
+
+	summary := &Summary{}
+	if err := json.Unmarshal(data, summary); err != nil {
+		return nil, fmt.Errorf("unable to decode stats/summary for node %s: %v", node, err)
+	}
+	return summary, nil
+}
+
+// KubeletClientForMode selects between a direct and an API-proxy kubelet
+// client based on mode, so callers (cmd/metrics-server/app) don't need to
+// know about proxyKubeletClient directly.
+func KubeletClientForMode(mode ScrapeMode, kubeletConfig *KubeletClientConfig, clientConfig *rest.Config) (KubeletInterface, error) {
+	switch mode {
+	case ScrapeModeAPIProxy:
+		return NewProxyKubeletClient(clientConfig)
+	case ScrapeModeDirect, "":
+		return KubeletClientFor(kubeletConfig)
+	default:
+		return nil, fmt.Errorf("unknown kubelet scrape mode %q", mode)
+	}
+}